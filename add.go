@@ -0,0 +1,54 @@
+package buildah
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/storage/pkg/archive"
+)
+
+// Add copies the contents of the named sources, which are paths to files or
+// directories on the host (URLs are not fetched), into the container's root
+// filesystem, relative
+// to the container's MountPoint, at destination.  If extract is true, and a
+// source is an archive that "docker build"'s ADD would know how to handle,
+// it's extracted into destination instead of being copied as a single
+// file.  The container must already be mounted.
+func (b *Builder) Add(destination string, extract bool, source ...string) error {
+	if b.MountPoint == "" {
+		return fmt.Errorf("container %q is not mounted", b.ContainerID)
+	}
+	dest := filepath.Join(b.MountPoint, destination)
+	if destination == "" || destination[len(destination)-1] == '/' {
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return fmt.Errorf("error creating directory %q: %v", dest, err)
+		}
+	}
+	for _, src := range source {
+		if err := b.addFile(src, dest, extract); err != nil {
+			return fmt.Errorf("error adding %q to %q: %v", src, dest, err)
+		}
+	}
+	return nil
+}
+
+// addFile copies a single source into dest, extracting it in place if
+// extract is true and the source looks like an archive.
+func (b *Builder) addFile(src, dest string, extract bool) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if extract && !info.IsDir() && archive.IsArchivePath(src) {
+		return archive.UntarPath(src, dest)
+	}
+	if info.IsDir() {
+		return archive.CopyWithTar(src, dest)
+	}
+	target := dest
+	if fi, err := os.Stat(dest); err == nil && fi.IsDir() {
+		target = filepath.Join(dest, filepath.Base(src))
+	}
+	return archive.CopyWithTar(src, target)
+}
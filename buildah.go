@@ -6,8 +6,10 @@ import (
 	"io/ioutil"
 	"path/filepath"
 
+	"github.com/containers/storage/pkg/idtools"
 	"github.com/containers/storage/pkg/ioutils"
 	"github.com/containers/storage/storage"
+	"github.com/nalind/buildah/unshare"
 )
 
 const (
@@ -89,6 +91,29 @@ type Builder struct {
 	Volumes []string `json:"volumes,omitempty"`
 	// Arg is a set of build-time variables.
 	Arg map[string]string `json:"arg,omitempty"`
+
+	// IDMappingOptions is the UID/GID mapping, if any, that was used to
+	// create the container and should be used again to re-enter its user
+	// and mount namespaces on a later OpenBuilder call.
+	IDMappingOptions IDMappingOptions `json:"idmapping-options,omitempty"`
+}
+
+// IDMappingOptions controls how a Builder's container is placed into a new
+// user namespace, for rootless operation.
+type IDMappingOptions struct {
+	// HostUIDMapping makes the container's UID mapping the same as the
+	// one the calling process already has, i.e., effectively disables
+	// remapping.
+	HostUIDMapping bool
+	// HostGIDMapping makes the container's GID mapping the same as the
+	// one the calling process already has, i.e., effectively disables
+	// remapping.
+	HostGIDMapping bool
+	// UIDMap, if HostUIDMapping is false, is the mapping to use for UIDs.
+	UIDMap []idtools.IDMap
+	// GIDMap, if HostGIDMapping is false, is the mapping to use for
+	// GIDs.
+	GIDMap []idtools.IDMap
 }
 
 // BuilderOptions are used to initialize a Builder.
@@ -122,6 +147,9 @@ type BuilderOptions struct {
 	// specified, indicating that the shared, system-wide default policy
 	// should be used.
 	SignaturePolicyPath string
+	// IDMappingOptions specifies the UID/GID mapping to use for the
+	// container's user and mount namespaces, for rootless operation.
+	IDMappingOptions IDMappingOptions
 }
 
 // ImportOptions are used to initialize a Builder.
@@ -165,6 +193,9 @@ func OpenBuilder(store storage.Store, container string) (*Builder, error) {
 	if b.Type != containerType {
 		return nil, fmt.Errorf("container is not a %s container", Package)
 	}
+	if !b.IDMappingOptions.HostUIDMapping || !b.IDMappingOptions.HostGIDMapping {
+		unshare.MaybeReexecUsingUserNamespace(b.IDMappingOptions.UIDMap, b.IDMappingOptions.GIDMap)
+	}
 	b.store = store
 	return b, nil
 }
@@ -0,0 +1,82 @@
+package buildah
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/containers/storage/pkg/mount"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// runUsingChroot runs spec.Process.Args with rootfs as its root directory,
+// using syscall.Chroot instead of an external OCI runtime.  It's slower and
+// less isolated than IsolationOCI, but it works in places where invoking a
+// separate runtime binary, possibly requiring its own privileges, isn't an
+// option, which makes it a better fit for rootless use.
+func runUsingChroot(spec *specs.Spec, rootfs string, options RunOptions) error {
+	cleanupMounts, err := mountSpecMounts(rootfs, spec.Mounts)
+	if err != nil {
+		return err
+	}
+	defer cleanupMounts()
+
+	if len(spec.Process.Args) == 0 {
+		return fmt.Errorf("no command specified")
+	}
+	cmd := exec.Command(spec.Process.Args[0], spec.Process.Args[1:]...)
+	cmd.Env = spec.Process.Env
+	cmd.Dir = spec.Process.Cwd
+	if cmd.Dir == "" {
+		cmd.Dir = "/"
+	}
+	cmd.Stdin = options.Stdin
+	cmd.Stdout = options.Stdout
+	cmd.Stderr = options.Stderr
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Chroot:     rootfs,
+		Cloneflags: syscall.CLONE_NEWNS,
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running %v in chroot at %q: %v", spec.Process.Args, rootfs, err)
+	}
+	return nil
+}
+
+// mountSpecMounts mounts each entry in mounts, using its Source, Type, and
+// Options, at its destination under rootfs, and returns a function which undoes them in
+// reverse order.
+func mountSpecMounts(rootfs string, mounts []specs.Mount) (func(), error) {
+	var mountedAt []string
+	cleanup := func() {
+		for i := len(mountedAt) - 1; i >= 0; i-- {
+			if err := mount.Unmount(mountedAt[i]); err != nil {
+				logrus.Debugf("error unmounting %q: %v", mountedAt[i], err)
+			}
+		}
+	}
+	for _, m := range mounts {
+		target := filepath.Join(rootfs, m.Destination)
+		if err := os.MkdirAll(target, 0755); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("error creating mountpoint %q: %v", target, err)
+		}
+		if err := mount.Mount(m.Source, target, m.Type, strings.Join(m.Options, ",")); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("error mounting %q on %q: %v", m.Source, target, err)
+		}
+		mountedAt = append(mountedAt, target)
+	}
+	return cleanup, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nalind/buildah/imagebuildah"
+	"github.com/urfave/cli"
+)
+
+var (
+	buildFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "file, f",
+			Usage: "name of the Dockerfile to use, relative to the context directory",
+		},
+		cli.StringFlag{
+			Name:  "tag, t",
+			Usage: "tag to apply to the resulting image",
+		},
+		cli.StringSliceFlag{
+			Name:  "build-arg",
+			Usage: "build-time variable, in the form name=value",
+		},
+		cli.StringFlag{
+			Name:  "signature-policy",
+			Usage: "signature policy path",
+		},
+	}
+)
+
+func buildCmd(c *cli.Context) error {
+	args := c.Args()
+	if len(args) == 0 {
+		return cli.NewExitError("a context directory must be specified", 1)
+	}
+	if len(args) > 1 {
+		return cli.NewExitError("only one context directory may be specified", 1)
+	}
+
+	store, err := getStore(c)
+	if err != nil {
+		return err
+	}
+
+	options := imagebuildah.BuildOptions{
+		ContextDirectory:    args[0],
+		Dockerfile:          c.String("file"),
+		Output:              c.String("tag"),
+		SignaturePolicyPath: c.String("signature-policy"),
+		BuildArgs:           parseBuildArgs(c.StringSlice("build-arg")),
+		Out:                 os.Stdout,
+		Err:                 os.Stderr,
+		ReportWriter:        os.Stderr,
+	}
+
+	imageID, err := imagebuildah.BuildDockerfile(store, options)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "%s\n", imageID)
+	return nil
+}
+
+func parseBuildArgs(args []string) map[string]string {
+	buildArgs := make(map[string]string)
+	for _, arg := range args {
+		if kv := strings.SplitN(arg, "=", 2); len(kv) == 2 {
+			buildArgs[kv[0]] = kv[1]
+		}
+	}
+	return buildArgs
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/containers/image/transports/alltransports"
+	"github.com/nalind/buildah"
+	"github.com/urfave/cli"
+)
+
+var (
+	commitFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "format",
+			Usage: "preferred manifest type (docker or oci)",
+			Value: "docker",
+		},
+		cli.StringFlag{
+			Name:  "signature-policy",
+			Usage: "signature policy path",
+		},
+	}
+)
+
+func commitCmd(c *cli.Context) error {
+	args := c.Args()
+	if len(args) == 0 {
+		return cli.NewExitError("container name or ID must be specified", 1)
+	}
+	if len(args) == 1 {
+		return cli.NewExitError("destination image name must be specified", 1)
+	}
+	if len(args) > 2 {
+		return cli.NewExitError("too many arguments specified", 1)
+	}
+	name := args[0]
+
+	store, err := getStore(c)
+	if err != nil {
+		return err
+	}
+
+	builder, err := buildah.OpenBuilder(store, name)
+	if err != nil {
+		return fmt.Errorf("error reading build container %q: %v", name, err)
+	}
+
+	dest, err := alltransports.ParseImageName(args[1])
+	if err != nil {
+		dest, err = alltransports.ParseImageName("containers-storage:" + args[1])
+		if err != nil {
+			return fmt.Errorf("error parsing target image name %q: %v", args[1], err)
+		}
+	}
+
+	options := buildah.CommitOptions{
+		PreferredManifestType: manifestType(c.String("format")),
+		SignaturePolicyPath:   c.String("signature-policy"),
+		ReportWriter:          os.Stderr,
+	}
+
+	imageID, err := builder.Commit(context.TODO(), dest, options)
+	if err != nil {
+		return fmt.Errorf("error committing container %q: %v", name, err)
+	}
+
+	fmt.Fprintf(os.Stdout, "%s\n", imageID)
+	return nil
+}
+
+func manifestType(format string) string {
+	if format == "oci" {
+		return "application/vnd.oci.image.manifest.v1+json"
+	}
+	return "application/vnd.docker.distribution.manifest.v2+json"
+}
@@ -0,0 +1,12 @@
+package main
+
+import "testing"
+
+func TestManifestType(t *testing.T) {
+	if manifestType("oci") != "application/vnd.oci.image.manifest.v1+json" {
+		t.Errorf("expected the oci format to select the OCI manifest type")
+	}
+	if manifestType("docker") != "application/vnd.docker.distribution.manifest.v2+json" {
+		t.Errorf("expected any other format to default to the docker manifest type")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/nalind/buildah/pull"
+	"github.com/urfave/cli"
+)
+
+var (
+	pullFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "signature-policy",
+			Usage: "signature policy path",
+		},
+		cli.StringFlag{
+			Name:  "blob-cache",
+			Usage: "directory for the cache of information about blobs seen in earlier pulls",
+		},
+	}
+)
+
+func pullCmd(c *cli.Context) error {
+	args := c.Args()
+	if len(args) == 0 {
+		return cli.NewExitError("an image name must be specified", 1)
+	}
+	if len(args) > 1 {
+		return cli.NewExitError("too many arguments specified", 1)
+	}
+
+	store, err := getStore(c)
+	if err != nil {
+		return err
+	}
+
+	options := pull.PullOptions{
+		SignaturePolicyPath: c.String("signature-policy"),
+		BlobDirectory:       c.String("blob-cache"),
+		ReportWriter:        os.Stderr,
+	}
+
+	imageID, err := pull.Pull(context.TODO(), store, args[0], options)
+	if err != nil {
+		return fmt.Errorf("error pulling image %q: %v", args[0], err)
+	}
+
+	fmt.Fprintf(os.Stdout, "%s\n", imageID)
+	return nil
+}
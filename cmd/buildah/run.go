@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nalind/buildah"
+	"github.com/urfave/cli"
+)
+
+var (
+	runFlags = append(append([]cli.Flag{}, runConfigurationFlags...),
+		cli.StringFlag{
+			Name:  "runtime",
+			Usage: "name of the OCI runtime to use",
+			Value: buildah.DefaultRuntime,
+		},
+		cli.StringFlag{
+			Name:  "isolation",
+			Usage: "isolation to use (oci or chroot)",
+			Value: "oci",
+		},
+	)
+)
+
+func runCmd(c *cli.Context) error {
+	args := c.Args()
+	if len(args) == 0 {
+		return cli.NewExitError("container name or ID must be specified", 1)
+	}
+	name := args[0]
+	command := args.Tail()
+	if len(command) == 0 {
+		return cli.NewExitError("command to run must be specified", 1)
+	}
+
+	store, err := getStore(c)
+	if err != nil {
+		return err
+	}
+
+	builder, err := buildah.OpenBuilder(store, name)
+	if err != nil {
+		return fmt.Errorf("error reading build container %q: %v", name, err)
+	}
+
+	options := buildah.RunOptions{
+		Hostname:  c.String("hostname"),
+		Runtime:   c.String("runtime"),
+		Isolation: parseIsolation(c.String("isolation")),
+	}
+	if c.IsSet("user") {
+		builder.User = c.String("user")
+	}
+	if c.IsSet("workingdir") {
+		builder.Workdir = c.String("workingdir")
+	}
+	if c.IsSet("env") {
+		builder.Env = append(builder.Env, c.StringSlice("env")...)
+	}
+
+	return builder.Run(command, options)
+}
+
+func parseIsolation(isolation string) buildah.Isolation {
+	if isolation == "chroot" {
+		return buildah.IsolationChroot
+	}
+	return buildah.IsolationOCI
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/containers/storage/pkg/idtools"
+	"github.com/nalind/buildah/unshare"
+	"github.com/urfave/cli"
+)
+
+var (
+	unshareFlags = []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "uidmap",
+			Usage: "containerUID:hostUID:length mapping to use, may be used more than once",
+		},
+		cli.StringSliceFlag{
+			Name:  "gidmap",
+			Usage: "containerGID:hostGID:length mapping to use, may be used more than once",
+		},
+	}
+)
+
+func unshareCmd(c *cli.Context) error {
+	uidmap, gidmap, err := unshareMappings(c)
+	if err != nil {
+		return err
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	args := c.Args()
+	if len(args) == 0 {
+		args = []string{shell}
+	}
+
+	unshare.MaybeReexecUsingUserNamespace(uidmap, gidmap)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// unshareMappings builds UID/GID mappings for the unshare command from
+// explicit --uidmap/--gidmap flags, falling back to the calling user's
+// /etc/subuid and /etc/subgid entries.
+func unshareMappings(c *cli.Context) ([]idtools.IDMap, []idtools.IDMap, error) {
+	if c.IsSet("uidmap") || c.IsSet("gidmap") {
+		uidmap, err := parseIDMappings(c.StringSlice("uidmap"))
+		if err != nil {
+			return nil, nil, err
+		}
+		gidmap, err := parseIDMappings(c.StringSlice("gidmap"))
+		if err != nil {
+			return nil, nil, err
+		}
+		return uidmap, gidmap, nil
+	}
+
+	me, err := user.Current()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error determining current user: %v", err)
+	}
+	mappings, err := idtools.NewIDMappings(me.Username, me.Username)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading subuid/subgid mappings for %q: %v", me.Username, err)
+	}
+	return mappings.UIDs(), mappings.GIDs(), nil
+}
+
+func parseIDMappings(specs []string) ([]idtools.IDMap, error) {
+	var mappings []idtools.IDMap
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid mapping %q: expected containerID:hostID:length", spec)
+		}
+		containerID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid mapping %q: %v", spec, err)
+		}
+		hostID, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid mapping %q: %v", spec, err)
+		}
+		size, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid mapping %q: %v", spec, err)
+		}
+		mappings = append(mappings, idtools.IDMap{ContainerID: containerID, HostID: hostID, Size: size})
+	}
+	return mappings, nil
+}
@@ -0,0 +1,107 @@
+package buildah
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	cp "github.com/containers/image/copy"
+	"github.com/containers/image/signature"
+	istorage "github.com/containers/image/storage"
+	"github.com/containers/image/types"
+)
+
+// CommitOptions can be used to alter how an image is committed.
+type CommitOptions struct {
+	// PreferredManifestType is the format to use when saving the image
+	// using containers/image.  If omitted, a reasonable default -
+	// currently the Docker schema2 format - is used.  Accepted values
+	// are the MediaType constants defined by
+	// github.com/containers/image/manifest.
+	PreferredManifestType string
+	// SignaturePolicyPath specifies an override location for the
+	// signature policy which should be used for verifying the new image
+	// as it is being written.  Except in specific circumstances, no
+	// value should be specified, indicating that the shared, system-wide
+	// default policy should be used.
+	SignaturePolicyPath string
+	// ReportWriter is an io.Writer which will be used to report the
+	// writing of the new image.
+	ReportWriter io.Writer
+	// HistoryTimestamp, if set, is used as the timestamp for the new
+	// image's history entry instead of the current time.
+	HistoryTimestamp *time.Time
+}
+
+// Commit writes the contents of the container, along with its updated
+// configuration, as a new image to the destination image reference dest,
+// using dest's transport to decide where and how to save the image, and
+// returns the ID of the new image if it was written to local storage, or an
+// empty string for any other transport.  If dest is nil, the image is saved as an
+// anonymous, untagged image in local storage, for use as an intermediate
+// result (for example, a non-final stage of a multi-stage build).
+func (b *Builder) Commit(ctx context.Context, dest types.ImageReference, options CommitOptions) (string, error) {
+	src, err := b.newImageRef(options)
+	if err != nil {
+		return "", fmt.Errorf("error computing layer and configuration for container %q: %v", b.ContainerID, err)
+	}
+
+	if dest == nil {
+		anonymousDest, err := istorage.Transport.NewStoreReference(b.store, nil, "")
+		if err != nil {
+			return "", fmt.Errorf("error creating an anonymous local image reference: %v", err)
+		}
+		dest = anonymousDest
+	}
+
+	systemContext := &types.SystemContext{}
+	if options.SignaturePolicyPath != "" {
+		systemContext.SignaturePolicyPath = options.SignaturePolicyPath
+	}
+
+	policy, err := signature.DefaultPolicy(systemContext)
+	if err != nil {
+		return "", fmt.Errorf("error obtaining default signature policy: %v", err)
+	}
+	policyContext, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return "", fmt.Errorf("error creating signature policy context: %v", err)
+	}
+	defer policyContext.Destroy()
+
+	err = cp.Image(policyContext, dest, src, &cp.Options{
+		ReportWriter: options.ReportWriter,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error copying layers and metadata for container %q to %q: %v", b.ContainerID, transportName(dest), err)
+	}
+
+	imageID, err := imageIDFromReference(b, ctx, systemContext, dest)
+	if err != nil {
+		return "", err
+	}
+
+	return imageID, nil
+}
+
+func transportName(ref types.ImageReference) string {
+	if ref == nil || ref.Transport() == nil {
+		return ""
+	}
+	return ref.Transport().Name()
+}
+
+// imageIDFromReference returns the local storage image ID that dest now
+// refers to, if dest uses the "containers-storage:" transport; for any
+// other transport, there's no local image ID to report, so "" is returned.
+func imageIDFromReference(b *Builder, ctx context.Context, systemContext *types.SystemContext, dest types.ImageReference) (string, error) {
+	if transportName(dest) != "containers-storage" {
+		return "", nil
+	}
+	img, err := istorage.Transport.GetStoreImage(b.store, dest)
+	if err != nil {
+		return "", fmt.Errorf("error reading back committed image: %v", err)
+	}
+	return img.ID, nil
+}
@@ -0,0 +1,307 @@
+package buildah
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	"github.com/containers/storage/pkg/archive"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// containerImageRef is a types.ImageReference which reads its manifest,
+// configuration, and layers from a Builder's container and the image it was
+// based on, rather than from a transport-specific location.  It's only ever
+// used as the source half of a containers/image copy.Image() call, never as
+// a destination.
+type containerImageRef struct {
+	builder               *Builder
+	layerID               string
+	compression           archive.Compression
+	preferredManifestType string
+	createdBy             string
+	created               time.Time
+}
+
+func (b *Builder) newImageRef(options CommitOptions) (types.ImageReference, error) {
+	container, err := b.store.Container(b.ContainerID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading container %q: %v", b.ContainerID, err)
+	}
+	created := time.Now().UTC()
+	if options.HistoryTimestamp != nil {
+		created = options.HistoryTimestamp.UTC()
+	}
+	preferredManifestType := options.PreferredManifestType
+	if preferredManifestType == "" {
+		preferredManifestType = manifest.DockerV2Schema2MediaType
+	}
+	return &containerImageRef{
+		builder:               b,
+		layerID:               container.LayerID,
+		compression:           archive.Gzip,
+		preferredManifestType: preferredManifestType,
+		createdBy:             b.CreatedBy,
+		created:               created,
+	}, nil
+}
+
+func (ref *containerImageRef) Transport() types.ImageTransport {
+	return nil
+}
+
+func (ref *containerImageRef) StringWithinTransport() string {
+	return ref.builder.ContainerID
+}
+
+func (ref *containerImageRef) DockerReference() reference.Named {
+	return nil
+}
+
+func (ref *containerImageRef) PolicyConfigurationIdentity() string {
+	return ""
+}
+
+func (ref *containerImageRef) PolicyConfigurationNamespaces() []string {
+	return nil
+}
+
+func (ref *containerImageRef) NewImage(ctx context.Context, sys *types.SystemContext) (types.ImageCloser, error) {
+	return nil, fmt.Errorf("committing directly to an image is not supported")
+}
+
+func (ref *containerImageRef) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	manifestBytes, manifestType, configBytes, layers, err := ref.buildManifestAndConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &containerImageSource{
+		ref:           ref,
+		manifestBytes: manifestBytes,
+		manifestType:  manifestType,
+		configBytes:   configBytes,
+		layers:        layers,
+	}, nil
+}
+
+func (ref *containerImageRef) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	return nil, fmt.Errorf("container images can only be read, not written to")
+}
+
+func (ref *containerImageRef) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
+	return fmt.Errorf("deleting a container's synthetic image reference is not supported")
+}
+
+// layerBlob holds the information we need about one layer in the image's
+// layer chain: the digest of its uncompressed contents, for RootFS.DiffIDs,
+// and the digest, size, and actual compressed bytes of the blob that
+// GetBlob() will serve for it, for the manifest's layer descriptor.
+type layerBlob struct {
+	diffID     digest.Digest
+	blobDigest digest.Digest
+	blobBytes  []byte
+}
+
+// layerBlobs walks the container's layer back to the root, compressing each
+// layer in the chain in turn, so that the image this produces carries its
+// entire base image's layers, and not just the one the container added.
+// The result is ordered from the bottom of the rootfs up.
+func (ref *containerImageRef) layerBlobs() ([]layerBlob, error) {
+	b := ref.builder
+
+	var layerIDs []string
+	for id := ref.layerID; id != ""; {
+		layerIDs = append(layerIDs, id)
+		layer, err := b.store.Layer(id)
+		if err != nil {
+			return nil, fmt.Errorf("error reading layer %q: %v", id, err)
+		}
+		id = layer.Parent
+	}
+
+	blobs := make([]layerBlob, len(layerIDs))
+	for i, id := range layerIDs {
+		parentID := ""
+		if i+1 < len(layerIDs) {
+			parentID = layerIDs[i+1]
+		}
+
+		diffID, _, err := b.store.DiffSize(parentID, id)
+		if err != nil {
+			return nil, fmt.Errorf("error computing size of layer %q: %v", id, err)
+		}
+
+		diff, err := b.store.Diff(parentID, id, &archive.DiffOptions{
+			Compression: &ref.compression,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reading layer %q: %v", id, err)
+		}
+		blobBytes, err := ioutil.ReadAll(diff)
+		diff.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading compressed layer %q: %v", id, err)
+		}
+
+		// layerIDs is ordered leaf-to-root; blobs should be root-to-leaf.
+		blobs[len(layerIDs)-1-i] = layerBlob{
+			diffID:     diffID,
+			blobDigest: digest.FromBytes(blobBytes),
+			blobBytes:  blobBytes,
+		}
+	}
+	return blobs, nil
+}
+
+// parentHistory returns the source image's own History entries, so that
+// they can be prepended to the new layer's entry, if the builder's recorded
+// Config can be parsed as a schema2 or OCI image configuration.  A source
+// image recorded in another format, or no source image at all, yields no
+// entries, and the new layer's History is left to stand on its own.
+func parentHistory(config []byte) []imageHistory {
+	if len(config) == 0 {
+		return nil
+	}
+	var schema1 dockerSchema1Manifest
+	if err := json.Unmarshal(config, &schema1); err == nil && schema1.SchemaVersion == 1 {
+		return nil
+	}
+	var parsed imageConfig
+	if err := json.Unmarshal(config, &parsed); err != nil {
+		return nil
+	}
+	return parsed.History
+}
+
+// buildManifestAndConfig merges the builder's recorded configuration changes
+// with the source image's configuration and layer chain, and returns a
+// manifest and config in the requested format.
+func (ref *containerImageRef) buildManifestAndConfig() (manifestBytes []byte, manifestType string, configBytes []byte, layers []layerBlob, err error) {
+	b := ref.builder
+
+	layers, err = ref.layerBlobs()
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+
+	diffIDs := make([]digest.Digest, len(layers))
+	layerDescriptors := make([]imageDescriptor, len(layers))
+	for i, layer := range layers {
+		diffIDs[i] = layer.diffID
+		layerDescriptors[i] = imageDescriptor{
+			MediaType: manifestLayerMediaType(ref.preferredManifestType),
+			Digest:    layer.blobDigest,
+			Size:      int64(len(layer.blobBytes)),
+		}
+	}
+
+	history := append(parentHistory(b.Config), imageHistory{
+		Created:   ref.created,
+		CreatedBy: ref.createdBy,
+		Author:    b.Maintainer,
+		Comment:   b.Annotations["comment"],
+	})
+
+	config := imageConfig{
+		Created:      ref.created,
+		Architecture: b.Architecture,
+		OS:           b.OS,
+		Author:       b.Maintainer,
+		Config: imageConfigConfig{
+			User:         b.User,
+			Env:          b.Env,
+			Entrypoint:   b.Entrypoint,
+			Cmd:          b.Cmd,
+			Volumes:      b.Volumes,
+			WorkingDir:   b.Workdir,
+			Labels:       b.Labels,
+			ExposedPorts: b.Expose,
+		},
+		History: history,
+		RootFS: imageRootFS{
+			Type:    "layers",
+			DiffIDs: diffIDs,
+		},
+	}
+
+	configBytes, err = json.Marshal(&config)
+	if err != nil {
+		return nil, "", nil, nil, fmt.Errorf("error encoding image configuration: %v", err)
+	}
+	configDigest := digest.FromBytes(configBytes)
+
+	m := imageManifest{
+		SchemaVersion: 2,
+		MediaType:     ref.preferredManifestType,
+		Config: imageDescriptor{
+			MediaType: manifestConfigMediaType(ref.preferredManifestType),
+			Digest:    configDigest,
+			Size:      int64(len(configBytes)),
+		},
+		Layers: layerDescriptors,
+	}
+
+	manifestBytes, err = json.Marshal(&m)
+	if err != nil {
+		return nil, "", nil, nil, fmt.Errorf("error encoding image manifest: %v", err)
+	}
+
+	return manifestBytes, ref.preferredManifestType, configBytes, layers, nil
+}
+
+func manifestConfigMediaType(manifestType string) string {
+	if manifestType == manifest.OCIV1ImageManifest {
+		return "application/vnd.oci.image.config.v1+json"
+	}
+	return "application/vnd.docker.container.image.v1+json"
+}
+
+func manifestLayerMediaType(manifestType string) string {
+	if manifestType == manifest.OCIV1ImageManifest {
+		return "application/vnd.oci.image.layer.v1.tar+gzip"
+	}
+	return "application/vnd.docker.image.rootfs.diff.tar.gzip"
+}
+
+// containerImageSource is the types.ImageSource half of containerImageRef.
+type containerImageSource struct {
+	ref           *containerImageRef
+	manifestBytes []byte
+	manifestType  string
+	configBytes   []byte
+	layers        []layerBlob
+}
+
+func (s *containerImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+func (s *containerImageSource) Close() error {
+	return nil
+}
+
+func (s *containerImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	return s.manifestBytes, s.manifestType, nil
+}
+
+func (s *containerImageSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	return nil, nil
+}
+
+func (s *containerImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	if info.Digest == digest.FromBytes(s.configBytes) {
+		return noopCloser{bytesReader(s.configBytes)}, int64(len(s.configBytes)), nil
+	}
+	for _, layer := range s.layers {
+		if info.Digest == layer.blobDigest {
+			return noopCloser{bytesReader(layer.blobBytes)}, int64(len(layer.blobBytes)), nil
+		}
+	}
+	return nil, -1, fmt.Errorf("no such blob: %s", info.Digest)
+}
@@ -0,0 +1,127 @@
+package imagebuildah
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/containers/image/transports/alltransports"
+	"github.com/containers/image/types"
+	"github.com/containers/storage/storage"
+	"github.com/docker/docker/builder/dockerfile/parser"
+	"github.com/nalind/buildah"
+)
+
+const (
+	// DefaultRuntime is the default command to invoke when running the
+	// containers created by RUN instructions, if one isn't specified.
+	DefaultRuntime = "runc"
+	// DefaultDockerfile is the name we look for in the context directory
+	// if BuildOptions.Dockerfile is not set.
+	DefaultDockerfile = "Dockerfile"
+)
+
+// BuildOptions can be used to alter how an image is built.
+type BuildOptions struct {
+	// ContextDirectory is the directory which contains the Dockerfile and
+	// any other files which are referred to by ADD or COPY instructions
+	// in it.
+	ContextDirectory string
+	// Dockerfile is the name of the Dockerfile to use, relative to
+	// ContextDirectory.  If it's not set, DefaultDockerfile is assumed.
+	Dockerfile string
+	// Output is the name which should be assigned to the resulting
+	// image, if one is named.
+	Output string
+	// SignaturePolicyPath specifies an override location for the
+	// signature policy which should be used for verifying the new image
+	// as it is being written.  Except in specific circumstances, no
+	// value should be specified, indicating that the shared, system-wide
+	// default policy should be used.
+	SignaturePolicyPath string
+	// ReportWriter is an io.Writer which will be used to report the
+	// build's progress.
+	ReportWriter io.Writer
+	// Out and Err are where the standard output and standard error of
+	// RUN instructions are sent.
+	Out, Err io.Writer
+	// BuildArgs contains the values of ARG settings that were specified
+	// on the command line.
+	BuildArgs map[string]string
+}
+
+// BuildDockerfile parses a Dockerfile in options.ContextDirectory and runs
+// the instructions it contains against a succession of Builder objects,
+// producing a final image which is committed to options.Output, if it's set.
+func BuildDockerfile(store storage.Store, options BuildOptions) (string, error) {
+	dockerfile := options.Dockerfile
+	if dockerfile == "" {
+		dockerfile = DefaultDockerfile
+	}
+	dockerfilePath := filepath.Join(options.ContextDirectory, dockerfile)
+	contents, err := ioutil.ReadFile(dockerfilePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading %q: %v", dockerfilePath, err)
+	}
+
+	root, err := parser.Parse(bytes.NewReader(contents))
+	if err != nil {
+		return "", fmt.Errorf("error parsing %q: %v", dockerfilePath, err)
+	}
+
+	stages, err := newStages(root)
+	if err != nil {
+		return "", fmt.Errorf("error reading %q: %v", dockerfilePath, err)
+	}
+
+	exec, err := newExecutor(store, options)
+	if err != nil {
+		return "", fmt.Errorf("error preparing to process %q: %v", dockerfilePath, err)
+	}
+	defer exec.cleanupMounts()
+
+	imageID := ""
+	for i, stage := range stages {
+		last := i == len(stages)-1
+		id, err := exec.buildStage(stage, last)
+		if err != nil {
+			return "", fmt.Errorf("error building at step %+v: %v", stage, err)
+		}
+		imageID = id
+	}
+
+	return imageID, nil
+}
+
+// commitStage commits the builder's current state as a new image, naming it
+// dest if dest is not empty, and returns the resulting image ID.
+func commitStage(builder *buildah.Builder, dest string, options BuildOptions) (string, error) {
+	reference, err := resolveDestination(dest)
+	if err != nil {
+		return "", err
+	}
+	commitOptions := buildah.CommitOptions{
+		SignaturePolicyPath: options.SignaturePolicyPath,
+		ReportWriter:        options.ReportWriter,
+	}
+	return builder.Commit(context.TODO(), reference, commitOptions)
+}
+
+// resolveDestination parses dest as an image reference using the
+// "containers-storage:" transport, so that committed images land in the
+// same local storage that the builder is using.  An empty dest produces a
+// nil reference; Builder.Commit treats a nil destination as a request to
+// save an anonymous, untagged image, which is what intermediate stages need.
+func resolveDestination(dest string) (types.ImageReference, error) {
+	if dest == "" {
+		return nil, nil
+	}
+	reference, err := alltransports.ParseImageName("containers-storage:" + dest)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing reference for image %q: %v", dest, err)
+	}
+	return reference, nil
+}
@@ -0,0 +1,291 @@
+package imagebuildah
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/containers/storage/storage"
+	"github.com/docker/docker/builder/dockerfile/parser"
+	"github.com/nalind/buildah"
+)
+
+// Stage is a single FROM ... section of a Dockerfile, with the nodes which
+// follow it up to the next FROM (or the end of the file).
+type Stage struct {
+	Position int
+	Name     string
+	Base     string
+	Node     *parser.Node
+	Children []*parser.Node
+}
+
+// newStages splits the parsed Dockerfile into one Stage per FROM
+// instruction, recording the "AS name" of each stage, if one was given, so
+// that later stages can refer back to it.
+func newStages(root *parser.Node) ([]*Stage, error) {
+	var stages []*Stage
+	var current *Stage
+	for _, node := range root.Children {
+		if strings.EqualFold(node.Value, "from") {
+			if node.Next == nil {
+				return nil, fmt.Errorf("FROM requires an image name")
+			}
+			stage := &Stage{
+				Position: len(stages),
+				Base:     node.Next.Value,
+			}
+			if node.Next.Next != nil && strings.EqualFold(node.Next.Next.Value, "as") && node.Next.Next.Next != nil {
+				stage.Name = node.Next.Next.Next.Value
+			}
+			stage.Node = node
+			stages = append(stages, stage)
+			current = stage
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("no FROM statement found before %q", node.Value)
+		}
+		current.Children = append(current.Children, node)
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("no FROM statement found")
+	}
+	return stages, nil
+}
+
+// executor drives a set of Stages against a sequence of Builder objects,
+// keeping track of the image ID produced by each named stage so that later
+// stages can build on top of, or copy from, them.
+type executor struct {
+	store   storage.Store
+	options BuildOptions
+	// stages maps a stage's name and its position (as a string) to the ID
+	// of the image which was committed for it.
+	stages map[string]string
+	// mounts maps a stage's committed image ID, or the name of any other
+	// image named by COPY --from, to the mountpoint of a container which
+	// was created from it, so that COPY --from can read
+	// its contents without remounting it for every instruction.
+	mounts map[string]string
+	// mountContainers lists the containers created by mountStage, so that
+	// they can be cleaned up once the build is finished with them.
+	mountContainers []string
+}
+
+func newExecutor(store storage.Store, options BuildOptions) (*executor, error) {
+	return &executor{
+		store:   store,
+		options: options,
+		stages:  make(map[string]string),
+		mounts:  make(map[string]string),
+	}, nil
+}
+
+// mountStage returns the mountpoint of a container based on stageImage,
+// creating and mounting one the first time it's asked for.  stageImage may
+// be the ID of a stage built earlier in this Dockerfile, or the name of any
+// other image, in local storage or not.
+func (e *executor) mountStage(stageImage string) (string, error) {
+	if mountPoint, ok := e.mounts[stageImage]; ok {
+		return mountPoint, nil
+	}
+	builder, err := buildah.NewBuilder(e.store, buildah.BuilderOptions{
+		FromImage:     stageImage,
+		PullIfMissing: true,
+		Mount:         true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error mounting stage image %q: %v", stageImage, err)
+	}
+	e.mounts[stageImage] = builder.MountPoint
+	e.mountContainers = append(e.mountContainers, builder.ContainerID)
+	return builder.MountPoint, nil
+}
+
+// cleanupMounts unmounts and removes the containers created by mountStage
+// for COPY --from instructions, once the whole build no longer needs them.
+func (e *executor) cleanupMounts() {
+	for _, containerID := range e.mountContainers {
+		if err := e.store.Unmount(containerID); err != nil {
+			logrus.Errorf("error unmounting container %q: %v", containerID, err)
+		}
+		if err := e.store.DeleteContainer(containerID); err != nil {
+			logrus.Errorf("error removing container %q: %v", containerID, err)
+		}
+	}
+	e.mountContainers = nil
+	e.mounts = make(map[string]string)
+}
+
+// resolveBase returns the name that should be passed to NewBuilder as the
+// base image for a stage: either the image ID of an earlier stage with a
+// matching name, or the FROM value as written.
+func (e *executor) resolveBase(name string) string {
+	if resolved, ok := e.stages[name]; ok {
+		return resolved
+	}
+	return name
+}
+
+// buildStage runs every instruction in the stage against a new Builder, and
+// commits the result.  If this is the last stage and options.Output was
+// set, the image is also tagged as options.Output.
+func (e *executor) buildStage(stage *Stage, last bool) (string, error) {
+	builderOptions := buildah.BuilderOptions{
+		FromImage:           e.resolveBase(stage.Base),
+		PullIfMissing:       true,
+		SignaturePolicyPath: e.options.SignaturePolicyPath,
+		Mount:               true,
+	}
+	builder, err := buildah.NewBuilder(e.store, builderOptions)
+	if err != nil {
+		return "", fmt.Errorf("error creating build container for stage %d: %v", stage.Position, err)
+	}
+
+	args := make(map[string]string)
+	for k, v := range e.options.BuildArgs {
+		args[k] = v
+	}
+
+	createdBy := fmt.Sprintf("FROM %s", stage.Base)
+	for _, node := range stage.Children {
+		instruction := strings.ToUpper(node.Value)
+		if err := e.dispatch(builder, instruction, node, args); err != nil {
+			return "", fmt.Errorf("error building stage %d: %v", stage.Position, err)
+		}
+		createdBy = nodeToString(node)
+	}
+	builder.CreatedBy = createdBy
+
+	dest := ""
+	if last && e.options.Output != "" {
+		dest = e.options.Output
+	}
+	imageID, err := commitStage(builder, dest, e.options)
+	if err != nil {
+		return "", err
+	}
+
+	if err := e.store.Unmount(builder.ContainerID); err != nil {
+		logrus.Errorf("error unmounting build container for stage %d: %v", stage.Position, err)
+	}
+	if err := e.store.DeleteContainer(builder.ContainerID); err != nil {
+		logrus.Errorf("error removing build container for stage %d: %v", stage.Position, err)
+	}
+
+	if stage.Name != "" {
+		e.stages[stage.Name] = imageID
+	}
+	e.stages[strconv.Itoa(stage.Position)] = imageID
+
+	return imageID, nil
+}
+
+// dispatch applies a single Dockerfile instruction to builder.
+func (e *executor) dispatch(builder *buildah.Builder, instruction string, node *parser.Node, args map[string]string) error {
+	words := expandNode(node, args, builder.Arg)
+	switch instruction {
+	case "RUN":
+		return builder.Run(words, buildah.RunOptions{
+			Stdout: e.options.Out,
+			Stderr: e.options.Err,
+		})
+	case "COPY", "ADD":
+		if len(words) < 2 {
+			return fmt.Errorf("%s requires at least a source and a destination", instruction)
+		}
+		sourceDir := e.options.ContextDirectory
+		for _, flag := range node.Flags {
+			if strings.HasPrefix(flag, "--from=") {
+				stageImage := e.resolveBase(strings.TrimPrefix(flag, "--from="))
+				mountPoint, err := e.mountStage(stageImage)
+				if err != nil {
+					return err
+				}
+				sourceDir = mountPoint
+			}
+		}
+		sources := make([]string, 0, len(words)-1)
+		for _, source := range words[:len(words)-1] {
+			sources = append(sources, filepath.Join(sourceDir, source))
+		}
+		return builder.Add(words[len(words)-1], instruction == "ADD", sources...)
+	case "CMD":
+		builder.Cmd = words
+	case "ENTRYPOINT":
+		builder.Entrypoint = words
+	case "ENV":
+		for i := 0; i+1 < len(words); i += 2 {
+			builder.Env = append(builder.Env, words[i]+"="+words[i+1])
+		}
+	case "LABEL":
+		if builder.Labels == nil {
+			builder.Labels = make(map[string]string)
+		}
+		for i := 0; i+1 < len(words); i += 2 {
+			builder.Labels[words[i]] = words[i+1]
+		}
+	case "EXPOSE":
+		if builder.Expose == nil {
+			builder.Expose = make(map[string]interface{})
+		}
+		for _, port := range words {
+			builder.Expose[port] = struct{}{}
+		}
+	case "USER":
+		builder.User = strings.Join(words, "")
+	case "WORKDIR":
+		builder.Workdir = strings.Join(words, "")
+	case "VOLUME":
+		builder.Volumes = append(builder.Volumes, words...)
+	case "ARG":
+		for _, word := range words {
+			kv := strings.SplitN(word, "=", 2)
+			if len(kv) == 2 {
+				args[kv[0]] = kv[1]
+			}
+		}
+	default:
+		logrus.Debugf("ignoring unsupported instruction %q", instruction)
+	}
+	return nil
+}
+
+// nodeToString reconstructs a readable form of an instruction, for use as a
+// layer's CreatedBy description.
+func nodeToString(node *parser.Node) string {
+	parts := []string{strings.ToUpper(node.Value)}
+	for n := node.Next; n != nil; n = n.Next {
+		parts = append(parts, n.Value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// expandNode walks an instruction's arguments, substituting ARG/ENV style
+// ${name} and $name references against the supplied build args and the
+// builder's own recorded Arg values.
+func expandNode(node *parser.Node, args map[string]string, builderArgs map[string]string) []string {
+	var words []string
+	for n := node.Next; n != nil; n = n.Next {
+		words = append(words, expandArgs(n.Value, args, builderArgs))
+	}
+	return words
+}
+
+func expandArgs(value string, args map[string]string, builderArgs map[string]string) string {
+	return strings.NewReplacer(buildReplacements(args, builderArgs)...).Replace(value)
+}
+
+func buildReplacements(args map[string]string, builderArgs map[string]string) []string {
+	var pairs []string
+	for k, v := range args {
+		pairs = append(pairs, "$"+k, v, "${"+k+"}", v)
+	}
+	for k, v := range builderArgs {
+		pairs = append(pairs, "$"+k, v, "${"+k+"}", v)
+	}
+	return pairs
+}
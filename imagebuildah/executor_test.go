@@ -0,0 +1,81 @@
+package imagebuildah
+
+import (
+	"testing"
+
+	"github.com/docker/docker/builder/dockerfile/parser"
+)
+
+func node(value string, next ...*parser.Node) *parser.Node {
+	n := &parser.Node{Value: value}
+	current := n
+	for _, each := range next {
+		current.Next = each
+		current = each
+	}
+	return n
+}
+
+func TestNewStages(t *testing.T) {
+	root := &parser.Node{
+		Children: []*parser.Node{
+			node("from", node("alpine")),
+			node("run", node("true")),
+			node("from", node("alpine"), node("as"), node("builder")),
+			node("copy", node("."), node(".")),
+		},
+	}
+	stages, err := newStages(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stages) != 2 {
+		t.Fatalf("expected 2 stages, got %d", len(stages))
+	}
+	if stages[0].Base != "alpine" || stages[0].Name != "" {
+		t.Errorf("unexpected first stage: %+v", stages[0])
+	}
+	if len(stages[0].Children) != 1 {
+		t.Errorf("expected 1 child in first stage, got %d", len(stages[0].Children))
+	}
+	if stages[1].Name != "builder" {
+		t.Errorf("expected second stage to be named %q, got %q", "builder", stages[1].Name)
+	}
+}
+
+func TestNewStagesRequiresFrom(t *testing.T) {
+	root := &parser.Node{
+		Children: []*parser.Node{
+			node("run", node("true")),
+		},
+	}
+	if _, err := newStages(root); err == nil {
+		t.Errorf("expected an error for a Dockerfile with no FROM, got none")
+	}
+}
+
+func TestBuildReplacements(t *testing.T) {
+	builderArgs := map[string]string{"FOO": "bar"}
+	args := map[string]string{"FOO": "overridden", "BAZ": "qux"}
+	replaced := expandArgs("$FOO-${BAZ}", args, builderArgs)
+	if replaced != "overridden-qux" {
+		t.Errorf("expected build args to take precedence over builder args, got %q", replaced)
+	}
+}
+
+func TestExpandArgsLeavesUnknownReferencesAlone(t *testing.T) {
+	replaced := expandArgs("$UNKNOWN", map[string]string{}, map[string]string{})
+	if replaced != "$UNKNOWN" {
+		t.Errorf("expected unrecognized references to be left as-is, got %q", replaced)
+	}
+}
+
+func TestResolveDestinationEmpty(t *testing.T) {
+	ref, err := resolveDestination("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref != nil {
+		t.Errorf("expected a nil reference for an empty destination, got %#v", ref)
+	}
+}
@@ -0,0 +1,78 @@
+package buildah
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// imageConfig, imageConfigConfig, imageHistory, and imageRootFS mirror the
+// handful of fields of the OCI/Docker image configuration that Commit
+// populates from a Builder.  They're kept separate from the manifest types
+// below because the config is serialized as its own blob.
+type imageConfig struct {
+	Created      time.Time         `json:"created,omitempty"`
+	Author       string            `json:"author,omitempty"`
+	Architecture string            `json:"architecture"`
+	OS           string            `json:"os"`
+	Config       imageConfigConfig `json:"config"`
+	RootFS       imageRootFS       `json:"rootfs"`
+	History      []imageHistory    `json:"history,omitempty"`
+}
+
+type imageConfigConfig struct {
+	User         string                 `json:"User,omitempty"`
+	Env          []string               `json:"Env,omitempty"`
+	Entrypoint   []string               `json:"Entrypoint,omitempty"`
+	Cmd          []string               `json:"Cmd,omitempty"`
+	Volumes      []string               `json:"Volumes,omitempty"`
+	WorkingDir   string                 `json:"WorkingDir,omitempty"`
+	Labels       map[string]string      `json:"Labels,omitempty"`
+	ExposedPorts map[string]interface{} `json:"ExposedPorts,omitempty"`
+}
+
+type imageRootFS struct {
+	Type    string          `json:"type"`
+	DiffIDs []digest.Digest `json:"diff_ids"`
+}
+
+type imageHistory struct {
+	Created    time.Time `json:"created,omitempty"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	Author     string    `json:"author,omitempty"`
+	Comment    string    `json:"comment,omitempty"`
+	EmptyLayer bool      `json:"empty_layer,omitempty"`
+}
+
+// imageManifest and imageDescriptor describe the minimal fields we need in
+// order to produce either a Docker schema2 or an OCI image manifest; which
+// one is intended is recorded in MediaType.
+type imageManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        imageDescriptor   `json:"config"`
+	Layers        []imageDescriptor `json:"layers"`
+}
+
+type imageDescriptor struct {
+	MediaType string        `json:"mediaType"`
+	Digest    digest.Digest `json:"digest"`
+	Size      int64         `json:"size"`
+}
+
+// noopCloser adapts an io.Reader which doesn't need closing to the
+// io.ReadCloser interface that types.ImageSource.GetBlob is required to
+// return.
+type noopCloser struct {
+	io.Reader
+}
+
+func (noopCloser) Close() error {
+	return nil
+}
+
+func bytesReader(b []byte) io.Reader {
+	return bytes.NewReader(b)
+}
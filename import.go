@@ -0,0 +1,165 @@
+package buildah
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/containers/storage/storage"
+)
+
+// importBuilder reconstructs a Builder either from a container which
+// already exists in store, whether or not buildah created it, or, failing
+// that, from an image, by creating a new container based on it.
+func importBuilder(store storage.Store, options ImportOptions) (*Builder, error) {
+	if options.Container == "" {
+		return nil, fmt.Errorf("container name must be specified")
+	}
+
+	if container, err := store.Container(options.Container); err == nil {
+		return importBuilderFromContainer(store, container, options)
+	}
+
+	return importBuilderFromImage(store, options)
+}
+
+// importBuilderFromContainer builds a Builder around a container that
+// already exists in store, whether or not it was buildah which created it,
+// by reading back the image configuration it was based on and reusing the
+// container's existing root filesystem.
+func importBuilderFromContainer(store storage.Store, container *storage.Container, options ImportOptions) (*Builder, error) {
+	builder := &Builder{
+		store:       store,
+		Type:        containerType,
+		Container:   container.ID,
+		ContainerID: container.ID,
+	}
+	if len(container.Names) > 0 {
+		builder.Container = container.Names[0]
+	}
+
+	if container.ImageID != "" {
+		image, err := store.GetImage(container.ImageID)
+		if err != nil {
+			return nil, fmt.Errorf("error reading image %q for container %q: %v", container.ImageID, container.ID, err)
+		}
+		builder.FromImage = container.ImageID
+		builder.Config = []byte(image.Metadata)
+		if manifestBytes, err := store.ImageBigData(container.ImageID, "manifest"); err == nil {
+			builder.Manifest = manifestBytes
+		}
+		if err := builder.importImageConfig(builder.Config); err != nil {
+			return nil, fmt.Errorf("error parsing image configuration for container %q: %v", container.ID, err)
+		}
+	}
+
+	if err := builder.Save(); err != nil {
+		return nil, fmt.Errorf("error saving builder state for container %q: %v", container.ID, err)
+	}
+
+	return builder, nil
+}
+
+// importBuilderFromImage creates a new container based on options.Container,
+// treated as an image reference, and builds a Builder around it.
+func importBuilderFromImage(store storage.Store, options ImportOptions) (*Builder, error) {
+	image, err := store.GetImage(options.Container)
+	if err != nil {
+		return nil, fmt.Errorf("error locating %q as either a container or an image: %v", options.Container, err)
+	}
+
+	container, err := store.CreateContainer("", nil, image.ID, "", containerType, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating container from image %q: %v", options.Container, err)
+	}
+
+	builder := &Builder{
+		store:       store,
+		Type:        containerType,
+		FromImage:   image.ID,
+		Container:   container.ID,
+		ContainerID: container.ID,
+		Config:      []byte(image.Metadata),
+	}
+	if len(container.Names) > 0 {
+		builder.Container = container.Names[0]
+	}
+	if manifestBytes, err := store.ImageBigData(image.ID, "manifest"); err == nil {
+		builder.Manifest = manifestBytes
+	}
+	if err := builder.importImageConfig(builder.Config); err != nil {
+		return nil, fmt.Errorf("error parsing image configuration for image %q: %v", options.Container, err)
+	}
+
+	if err := builder.Save(); err != nil {
+		return nil, fmt.Errorf("error saving builder state for container %q: %v", container.ID, err)
+	}
+
+	return builder, nil
+}
+
+// importImageConfig populates the builder's Cmd, Entrypoint, Env, Labels,
+// User, Workdir, Volumes, Expose, OS, and Architecture fields from a raw
+// image configuration blob, which may be either a schema2/OCI image config,
+// or a schema1 manifest whose most recent history entry carries the same
+// information under "v1Compatibility".
+func (b *Builder) importImageConfig(config []byte) error {
+	if len(config) == 0 {
+		return nil
+	}
+
+	var v1Compat dockerV1Compatibility
+	var schema1 dockerSchema1Manifest
+	if err := json.Unmarshal(config, &schema1); err == nil && schema1.SchemaVersion == 1 && len(schema1.History) > 0 {
+		if err := json.Unmarshal([]byte(schema1.History[0].V1Compatibility), &v1Compat); err != nil {
+			return fmt.Errorf("error parsing schema1 v1Compatibility history: %v", err)
+		}
+	} else {
+		var parsed imageConfig
+		if err := json.Unmarshal(config, &parsed); err != nil {
+			return fmt.Errorf("error parsing image configuration: %v", err)
+		}
+		v1Compat = dockerV1Compatibility{
+			Created:      parsed.Created,
+			Author:       parsed.Author,
+			Architecture: parsed.Architecture,
+			OS:           parsed.OS,
+			Config:       parsed.Config,
+		}
+	}
+
+	b.Maintainer = v1Compat.Author
+	b.Architecture = v1Compat.Architecture
+	b.OS = v1Compat.OS
+	b.User = v1Compat.Config.User
+	b.Env = v1Compat.Config.Env
+	b.Entrypoint = v1Compat.Config.Entrypoint
+	b.Cmd = v1Compat.Config.Cmd
+	b.Volumes = v1Compat.Config.Volumes
+	b.Workdir = v1Compat.Config.WorkingDir
+	b.Labels = v1Compat.Config.Labels
+	b.Expose = v1Compat.Config.ExposedPorts
+
+	return nil
+}
+
+// dockerV1Compatibility mirrors the per-layer "v1Compatibility" history
+// entries that schema1 manifests carry their image configuration in.
+type dockerV1Compatibility struct {
+	Created      time.Time         `json:"created,omitempty"`
+	Author       string            `json:"author,omitempty"`
+	Architecture string            `json:"architecture"`
+	OS           string            `json:"os"`
+	Config       imageConfigConfig `json:"config"`
+}
+
+// dockerSchema1Manifest is just enough of a schema1 manifest's shape to let
+// us find its most recent history entry.
+type dockerSchema1Manifest struct {
+	SchemaVersion int                    `json:"schemaVersion"`
+	History       []dockerSchema1History `json:"history"`
+}
+
+type dockerSchema1History struct {
+	V1Compatibility string `json:"v1Compatibility"`
+}
@@ -0,0 +1,84 @@
+package buildah
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestImportImageConfigSchema2(t *testing.T) {
+	config := imageConfig{
+		Architecture: "amd64",
+		OS:           "linux",
+		Author:       "someone@example.com",
+		Config: imageConfigConfig{
+			User:       "nobody",
+			Env:        []string{"PATH=/usr/bin"},
+			Entrypoint: []string{"/bin/sh"},
+			Cmd:        []string{"-c", "true"},
+			WorkingDir: "/srv",
+			Labels:     map[string]string{"com.example.label": "value"},
+		},
+	}
+	encoded, err := json.Marshal(&config)
+	if err != nil {
+		t.Fatalf("error encoding test schema2 config: %v", err)
+	}
+
+	b := &Builder{}
+	if err := b.importImageConfig(encoded); err != nil {
+		t.Fatalf("error importing schema2 config: %v", err)
+	}
+	if b.Architecture != "amd64" || b.OS != "linux" {
+		t.Errorf("unexpected architecture/os: %q/%q", b.Architecture, b.OS)
+	}
+	if b.User != "nobody" {
+		t.Errorf("unexpected user: %q", b.User)
+	}
+	if b.Workdir != "/srv" {
+		t.Errorf("unexpected workdir: %q", b.Workdir)
+	}
+	if b.Labels["com.example.label"] != "value" {
+		t.Errorf("unexpected labels: %#v", b.Labels)
+	}
+}
+
+func TestImportImageConfigSchema1(t *testing.T) {
+	v1Compat := dockerV1Compatibility{
+		Author:       "someone@example.com",
+		Architecture: "amd64",
+		OS:           "linux",
+		Config: imageConfigConfig{
+			User:       "nobody",
+			Cmd:        []string{"/bin/true"},
+			WorkingDir: "/srv",
+		},
+	}
+	v1CompatBytes, err := json.Marshal(&v1Compat)
+	if err != nil {
+		t.Fatalf("error encoding test v1Compatibility entry: %v", err)
+	}
+	manifest := dockerSchema1Manifest{
+		SchemaVersion: 1,
+		History: []dockerSchema1History{
+			{V1Compatibility: string(v1CompatBytes)},
+		},
+	}
+	encoded, err := json.Marshal(&manifest)
+	if err != nil {
+		t.Fatalf("error encoding test schema1 manifest: %v", err)
+	}
+
+	b := &Builder{}
+	if err := b.importImageConfig(encoded); err != nil {
+		t.Fatalf("error importing schema1 config: %v", err)
+	}
+	if b.Architecture != "amd64" || b.OS != "linux" {
+		t.Errorf("unexpected architecture/os: %q/%q", b.Architecture, b.OS)
+	}
+	if b.User != "nobody" {
+		t.Errorf("unexpected user: %q", b.User)
+	}
+	if len(b.Cmd) != 1 || b.Cmd[0] != "/bin/true" {
+		t.Errorf("unexpected cmd: %#v", b.Cmd)
+	}
+}
@@ -0,0 +1,115 @@
+package buildah
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/containers/storage/storage"
+	"github.com/nalind/buildah/pull"
+	"github.com/nalind/buildah/unshare"
+)
+
+// resolveImage returns the ID of the image named by options.FromImage,
+// pulling it into store first if options.PullAlways is set, or if it's not
+// already present and options.PullIfMissing is set.
+func resolveImage(store storage.Store, options BuilderOptions) (string, error) {
+	imageName := options.FromImage
+	if options.Registry != "" {
+		imageName = options.Registry + "/" + options.FromImage
+	}
+
+	if !options.PullAlways {
+		if image, err := store.GetImage(imageName); err == nil {
+			return image.ID, nil
+		}
+	}
+
+	if !options.PullAlways && !options.PullIfMissing {
+		return "", fmt.Errorf("image %q not present in local storage, and neither PullAlways nor PullIfMissing was set", imageName)
+	}
+
+	return pull.Pull(context.Background(), store, imageName, pull.PullOptions{
+		SignaturePolicyPath: options.SignaturePolicyPath,
+	})
+}
+
+// newBuilder creates a new build container, basing it on options.FromImage
+// unless that's empty or "scratch", in which case the container starts out
+// with an empty root filesystem.
+func newBuilder(store storage.Store, options BuilderOptions) (*Builder, error) {
+	var imageID, image string
+	if options.FromImage != "" && options.FromImage != "scratch" {
+		resolved, err := resolveImage(store, options)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving image %q: %v", options.FromImage, err)
+		}
+		imageID = resolved
+		image = options.FromImage
+	}
+
+	containerOptions := storage.ContainerOptions{}
+	if !options.IDMappingOptions.HostUIDMapping || !options.IDMappingOptions.HostGIDMapping {
+		containerOptions.IDMappingOptions = storage.IDMappingOptions{
+			HostUIDMapping: options.IDMappingOptions.HostUIDMapping,
+			HostGIDMapping: options.IDMappingOptions.HostGIDMapping,
+			UIDMap:         options.IDMappingOptions.UIDMap,
+			GIDMap:         options.IDMappingOptions.GIDMap,
+		}
+		// Re-exec into the user namespace these mappings describe
+		// before creating and mounting the container, so that a
+		// freshly-created builder behaves the same way as one that's
+		// reopened later via OpenBuilder.
+		unshare.MaybeReexecUsingUserNamespace(options.IDMappingOptions.UIDMap, options.IDMappingOptions.GIDMap)
+	}
+
+	container, err := store.CreateContainer("", []string{options.Container}, imageID, "", "", &containerOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error creating build container: %v", err)
+	}
+
+	builder := &Builder{
+		store:            store,
+		Type:             containerType,
+		FromImage:        image,
+		Container:        container.ID,
+		ContainerID:      container.ID,
+		IDMappingOptions: options.IDMappingOptions,
+	}
+	if len(container.Names) > 0 {
+		builder.Container = container.Names[0]
+	}
+
+	if imageID != "" {
+		if image, err := store.GetImage(imageID); err == nil {
+			builder.Config = []byte(image.Metadata)
+		}
+		if manifestBytes, err := store.ImageBigData(imageID, "manifest"); err == nil {
+			builder.Manifest = manifestBytes
+		}
+		if err := builder.importImageConfig(builder.Config); err != nil {
+			return nil, fmt.Errorf("error parsing image configuration for image %q: %v", options.FromImage, err)
+		}
+	}
+
+	if options.Mount {
+		mountPoint, err := store.Mount(container.ID, "")
+		if err != nil {
+			return nil, fmt.Errorf("error mounting build container %q: %v", container.ID, err)
+		}
+		builder.MountPoint = mountPoint
+		builder.Mounts = append(builder.Mounts, mountPoint)
+		if options.Link != "" {
+			if err := os.Symlink(mountPoint, options.Link); err != nil {
+				return nil, fmt.Errorf("error linking %q to %q: %v", options.Link, mountPoint, err)
+			}
+			builder.Links = append(builder.Links, options.Link)
+		}
+	}
+
+	if err := builder.Save(); err != nil {
+		return nil, fmt.Errorf("error saving builder state: %v", err)
+	}
+
+	return builder, nil
+}
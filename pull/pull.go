@@ -0,0 +1,133 @@
+// Package pull resolves an image name against a number of possible
+// transports and locations, and copies the result into local storage, for
+// use by buildah.NewBuilder and the "buildah pull" command.
+package pull
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	cp "github.com/containers/image/copy"
+	"github.com/containers/image/registries"
+	"github.com/containers/image/signature"
+	istorage "github.com/containers/image/storage"
+	"github.com/containers/image/transports/alltransports"
+	"github.com/containers/image/types"
+	"github.com/containers/storage/storage"
+)
+
+// knownTransports lists the transport prefixes that mean imageName already
+// names a source unambiguously, so no further candidates need to be tried.
+var knownTransports = []string{
+	"docker://",
+	"docker-daemon:",
+	"docker-archive:",
+	"oci:",
+	"oci-archive:",
+	"dir:",
+	"containers-storage:",
+}
+
+// PullOptions controls how Pull locates and copies an image.
+//
+// Pulling every tag of a repository instead of just one, as "docker pull
+// -a" does, isn't supported yet: Pull returns the ID of a single image, and
+// both of its callers (NewBuilder and the "buildah pull" command) assume
+// there's exactly one.  Supporting it means changing that return type, so
+// it's deferred rather than wired up as a silent no-op.
+type PullOptions struct {
+	// SignaturePolicyPath specifies an override location for the
+	// signature policy which should be used for verifying the image as
+	// it's being pulled.
+	SignaturePolicyPath string
+	// BlobDirectory is used as the directory for containers/image's blob
+	// info cache, which records what is known about blobs seen in earlier
+	// pulls.  The pulled layer and manifest blobs are not stored there.
+	BlobDirectory string
+	// ReportWriter is an io.Writer which will be used to report the
+	// pull's progress.
+	ReportWriter io.Writer
+}
+
+// Pull resolves imageName against a list of candidate transports and
+// locations - imageName itself, if it already names a transport; imageName
+// in local storage; and imageName prefixed with each configured search
+// registry, in turn - and copies the first one that succeeds into local
+// storage, returning the ID of the resulting image.
+func Pull(ctx context.Context, store storage.Store, imageName string, options PullOptions) (string, error) {
+	systemContext := &types.SystemContext{
+		SignaturePolicyPath: options.SignaturePolicyPath,
+		BlobInfoCacheDir:    options.BlobDirectory,
+	}
+
+	policy, err := signature.DefaultPolicy(systemContext)
+	if err != nil {
+		return "", fmt.Errorf("error obtaining default signature policy: %v", err)
+	}
+	policyContext, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return "", fmt.Errorf("error creating signature policy context: %v", err)
+	}
+	defer policyContext.Destroy()
+
+	var lastErr error
+	for _, candidate := range candidates(systemContext, imageName) {
+		srcRef, err := alltransports.ParseImageName(candidate)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		imageID, err := pullOne(ctx, store, policyContext, systemContext, srcRef, options)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return imageID, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no candidate sources found for %q", imageName)
+	}
+	return "", fmt.Errorf("error pulling image %q: %v", imageName, lastErr)
+}
+
+// candidates builds the list of fully-qualified source references that Pull
+// should try, in order, for imageName.
+func candidates(systemContext *types.SystemContext, imageName string) []string {
+	for _, transport := range knownTransports {
+		if strings.HasPrefix(imageName, transport) {
+			return []string{imageName}
+		}
+	}
+
+	list := []string{"containers-storage:" + imageName}
+	for _, registry := range registries.GetRegistries(systemContext) {
+		list = append(list, "docker://"+registry+"/"+imageName)
+	}
+	return list
+}
+
+// pullOne copies a single source reference into local storage and returns
+// the ID of the resulting image.
+func pullOne(ctx context.Context, store storage.Store, policyContext *signature.PolicyContext, systemContext *types.SystemContext, srcRef types.ImageReference, options PullOptions) (string, error) {
+	destRef, err := istorage.Transport.NewStoreReference(store, srcRef.DockerReference(), "")
+	if err != nil {
+		return "", fmt.Errorf("error computing local storage destination for %q: %v", srcRef.StringWithinTransport(), err)
+	}
+
+	err = cp.Image(policyContext, destRef, srcRef, &cp.Options{
+		ReportWriter:   options.ReportWriter,
+		SourceCtx:      systemContext,
+		DestinationCtx: systemContext,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error copying %q to local storage: %v", srcRef.StringWithinTransport(), err)
+	}
+
+	img, err := istorage.Transport.GetStoreImage(store, destRef)
+	if err != nil {
+		return "", fmt.Errorf("error locating newly-pulled image: %v", err)
+	}
+	return img.ID, nil
+}
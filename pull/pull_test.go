@@ -0,0 +1,23 @@
+package pull
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/containers/image/types"
+)
+
+func TestCandidatesKnownTransport(t *testing.T) {
+	candidates := candidates(&types.SystemContext{}, "docker://example.com/image:latest")
+	expected := []string{"docker://example.com/image:latest"}
+	if !reflect.DeepEqual(candidates, expected) {
+		t.Errorf("expected %#v, got %#v", expected, candidates)
+	}
+}
+
+func TestCandidatesBareName(t *testing.T) {
+	candidates := candidates(&types.SystemContext{}, "busybox")
+	if len(candidates) == 0 || candidates[0] != "containers-storage:busybox" {
+		t.Errorf("expected local storage to be tried first, got %#v", candidates)
+	}
+}
@@ -0,0 +1,273 @@
+package buildah
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/containers/storage/pkg/mount"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+)
+
+// Isolation selects how a Run's command is separated from the host.
+type Isolation int
+
+const (
+	// IsolationDefault runs the command using the best isolation that's
+	// available, which is currently IsolationOCI.
+	IsolationDefault Isolation = iota
+	// IsolationOCI runs the command using a bundle generated from the
+	// container's contents and an OCI runtime, such as runc or crun.
+	IsolationOCI
+	// IsolationChroot runs the command in a chroot of the container's
+	// root filesystem, without requiring an external runtime.  It's the
+	// more rootless-friendly option of the two.
+	IsolationChroot
+)
+
+// Sharing describes whether or not a CacheMount's contents are shared
+// between concurrent builds which request the same ID.
+type Sharing string
+
+const (
+	// SharingShared indicates that a cache's contents should be shared
+	// between concurrent users.
+	SharingShared Sharing = "shared"
+	// SharingPrivate indicates that a cache should be copied to a
+	// private location before use, so that concurrent users don't see
+	// each other's writes.
+	SharingPrivate Sharing = "private"
+	// SharingLocked indicates that only one user of a cache should be
+	// allowed to run at a time.
+	SharingLocked Sharing = "locked"
+)
+
+// CacheMount describes a directory which is mounted into the container for
+// the duration of a Run.  Run mounts a new, empty tmpfs at Target each time;
+// nothing written there is kept after the Run finishes.
+type CacheMount struct {
+	// ID identifies the cache.  Run does not use it: mounts with the same
+	// ID do not share contents.
+	ID string
+	// Target is the path, inside the container, where the cache should
+	// be mounted.
+	Target string
+	// Sharing names how concurrent builds which use the same ID would
+	// interact.  Run does not use it.
+	Sharing Sharing
+}
+
+// SecretMount describes a file or directory which should be made available
+// inside the container only for the duration of a Run, and which must not
+// be present in any layer that gets committed afterward.
+type SecretMount struct {
+	// Source is the location of the secret's contents on the host.
+	Source string
+	// Target is the path, inside the container, where the secret should
+	// be made available.
+	Target string
+	// Mode is not applied by Run: the secret is bind mounted read-only at
+	// Target, and keeps the permissions of Source.
+	Mode os.FileMode
+}
+
+// RunOptions can be used to alter how a command is run in a container.
+type RunOptions struct {
+	// Hostname is the hostname to set in the container's UTS namespace.
+	Hostname string
+	// Runtime is the OCI runtime binary (e.g. "runc" or "crun") to use
+	// when Isolation is IsolationOCI.  If it's unset, DefaultRuntime is
+	// used.
+	Runtime string
+	// Args are additional arguments to pass to the OCI runtime.
+	Args []string
+	// Mounts is a list of additional mounts, in OCI runtime spec form,
+	// to add to the generated bundle.
+	Mounts []specs.Mount
+	// BindMounts maps a path inside the container to a path on the host
+	// which should be bind mounted there for the duration of the Run.
+	BindMounts map[string]string
+	// CacheMounts are mounted as tmpfs-backed directories which start out
+	// empty for each Run; their contents do not persist across Run
+	// invocations.
+	CacheMounts []CacheMount
+	// SecretMounts are mounted only for the duration of the Run, and are
+	// guaranteed to not be present in any layer committed from the
+	// container afterward.
+	SecretMounts []SecretMount
+	// Isolation selects how the command is separated from the host.
+	Isolation Isolation
+	// Stdin, Stdout, and Stderr default to the running process's own
+	// standard input, output, and error if they're left unset.
+	Stdin          io.Reader
+	Stdout, Stderr io.Writer
+}
+
+// DefaultRuntime is the OCI runtime that's used when RunOptions.Runtime and
+// RunOptions.Isolation don't specify one.
+const DefaultRuntime = "runc"
+
+// Run runs the specified command in the container, using the container's
+// current configuration to build an OCI runtime spec, and either IsolationOCI
+// or IsolationChroot to execute it, depending on options.Isolation.
+func (b *Builder) Run(command []string, options RunOptions) error {
+	if b.MountPoint == "" {
+		return fmt.Errorf("container %q is not mounted", b.ContainerID)
+	}
+	if len(command) == 0 {
+		return fmt.Errorf("no command specified")
+	}
+
+	spec, err := b.generateRuntimeSpec(command, options)
+	if err != nil {
+		return err
+	}
+
+	teardownSecrets, err := b.setupSecretMounts(options.SecretMounts)
+	if err != nil {
+		return err
+	}
+	defer teardownSecrets()
+
+	if options.Isolation == IsolationChroot {
+		return runUsingChroot(spec, b.MountPoint, options)
+	}
+	return runUsingRuntime(spec, b.MountPoint, options)
+}
+
+// generateRuntimeSpec builds an OCI runtime spec describing command running
+// in the container's root filesystem, with the builder's current User,
+// Workdir, and Env settings applied.
+func (b *Builder) generateRuntimeSpec(command []string, options RunOptions) (*specs.Spec, error) {
+	g := generate.New()
+	g.SetProcessArgs(command)
+	g.SetProcessCwd(b.Workdir)
+	g.SetProcessTerminal(false)
+	g.SetRootPath(b.MountPoint)
+	g.SetHostname(options.Hostname)
+
+	for _, env := range b.Env {
+		g.AddProcessEnv(env)
+	}
+	if b.User != "" {
+		g.SetProcessUsername(b.User)
+	}
+
+	for _, m := range options.Mounts {
+		g.AddMount(m)
+	}
+	for target, source := range options.BindMounts {
+		g.AddMount(specs.Mount{
+			Destination: target,
+			Source:      source,
+			Type:        "bind",
+			Options:     []string{"bind", "rw"},
+		})
+	}
+	for _, c := range options.CacheMounts {
+		g.AddMount(specs.Mount{
+			Destination: c.Target,
+			Source:      c.Target,
+			Type:        "tmpfs",
+			Options:     []string{"rw", "nosuid", "nodev"},
+		})
+	}
+	for _, s := range options.SecretMounts {
+		g.AddMount(specs.Mount{
+			Destination: s.Target,
+			Source:      s.Source,
+			Type:        "bind",
+			Options:     []string{"bind", "ro"},
+		})
+	}
+
+	if !b.IDMappingOptions.HostUIDMapping || !b.IDMappingOptions.HostGIDMapping {
+		g.SetLinuxRootPropagation("rslave")
+		for _, m := range b.IDMappingOptions.UIDMap {
+			g.AddLinuxUIDMapping(uint32(m.HostID), uint32(m.ContainerID), uint32(m.Size))
+		}
+		for _, m := range b.IDMappingOptions.GIDMap {
+			g.AddLinuxGIDMapping(uint32(m.HostID), uint32(m.ContainerID), uint32(m.Size))
+		}
+	}
+
+	spec := g.Spec()
+	return spec, nil
+}
+
+// setupSecretMounts covers each SecretMount's target with an empty tmpfs on
+// the host before the command runs, and returns a function which unmounts
+// them again; this keeps a secret's contents from ever being visible to a
+// layer diff computed against the container's root filesystem.
+func (b *Builder) setupSecretMounts(secrets []SecretMount) (func(), error) {
+	var mounted []string
+	teardown := func() {
+		for i := len(mounted) - 1; i >= 0; i-- {
+			if err := mount.Unmount(mounted[i]); err != nil {
+				logrus.Debugf("error unmounting secret at %q: %v", mounted[i], err)
+			}
+		}
+	}
+	for _, secret := range secrets {
+		target := filepath.Join(b.MountPoint, secret.Target)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			teardown()
+			return nil, fmt.Errorf("error creating directory for secret at %q: %v", target, err)
+		}
+		if err := ioutil.WriteFile(target, nil, 0); err != nil {
+			teardown()
+			return nil, fmt.Errorf("error creating mountpoint for secret at %q: %v", target, err)
+		}
+		if err := mount.Mount("tmpfs", target, "tmpfs", "size=0"); err != nil {
+			teardown()
+			return nil, fmt.Errorf("error mounting tmpfs over secret target %q: %v", target, err)
+		}
+		mounted = append(mounted, target)
+	}
+	return teardown, nil
+}
+
+// runUsingRuntime writes spec to a fresh bundle directory and invokes the
+// configured OCI runtime against it.
+func runUsingRuntime(spec *specs.Spec, rootfs string, options RunOptions) error {
+	bundleDir, err := ioutil.TempDir("", Package)
+	if err != nil {
+		return fmt.Errorf("error creating bundle directory: %v", err)
+	}
+	defer os.RemoveAll(bundleDir)
+
+	specBytes, err := json.MarshalIndent(spec, "", "\t")
+	if err != nil {
+		return fmt.Errorf("error encoding runtime spec: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundleDir, "config.json"), specBytes, 0600); err != nil {
+		return fmt.Errorf("error writing runtime spec: %v", err)
+	}
+
+	runtime := options.Runtime
+	if runtime == "" {
+		runtime = DefaultRuntime
+	}
+	args := append(append([]string{}, options.Args...), "run", "--bundle", bundleDir, fmt.Sprintf("%s-%d", Package, os.Getpid()))
+	cmd := exec.Command(runtime, args...)
+	cmd.Dir = bundleDir
+	cmd.Stdin = options.Stdin
+	cmd.Stdout = options.Stdout
+	cmd.Stderr = options.Stderr
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running %q in container: %v", runtime, err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Package unshare allows a process to re-exec itself into a new user and
+// mount namespace with a configurable UID/GID mapping, which is how Builder
+// and its callers support running rootless.
+package unshare
+
+// The "C" import below is unused directly from Go, but it's what causes
+// unshare_linux.c, and its constructor which unshares our namespaces before
+// the Go runtime starts any other threads, to be compiled into this
+// package.
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/containers/storage/pkg/idtools"
+)
+
+// UsernsEnv is the name of the environment variable which, if present in
+// the environment of a freshly-exec'ed copy of ourselves, triggers the
+// constructor in unshare_linux.c to unshare() the namespaces named by its
+// value before the Go runtime starts any other threads.
+const UsernsEnv = "_Buildah-unshare"
+
+// Cmd wraps an exec.Cmd which re-execs the current binary into a new user
+// and mount namespace.  UidMappings and GidMappings, if set, are applied to
+// the child once it's told us that it's unshared its namespaces, and before
+// it's allowed to continue running.
+type Cmd struct {
+	*exec.Cmd
+	UidMappings []idtools.IDMap
+	GidMappings []idtools.IDMap
+}
+
+// Command returns a Cmd which will re-exec the current binary with args as
+// its arguments, ready to be Run() once its UID/GID mappings, if any, have
+// been set.
+func Command(args []string) *Cmd {
+	cmd := exec.Command("/proc/self/exe")
+	cmd.Args = args
+	return &Cmd{Cmd: cmd}
+}
+
+// Run configures the child's namespaces, starts it, writes the requested
+// UID/GID mappings, and waits for it to exit.
+func (c *Cmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Start sets up a synchronization socket with the child, starts it, and
+// waits for it to signal that it has unshared its namespaces before writing
+// its UID/GID mappings and letting it continue.
+func (c *Cmd) Start() error {
+	parentFile, childFile, err := socketPair()
+	if err != nil {
+		return fmt.Errorf("error creating socket pair for unshare: %v", err)
+	}
+	defer parentFile.Close()
+
+	env := c.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	c.Env = append(env, fmt.Sprintf("%s=%d", UsernsEnv, syscall.CLONE_NEWUSER|syscall.CLONE_NEWNS))
+	c.ExtraFiles = append(c.ExtraFiles, childFile)
+
+	if err := c.Cmd.Start(); err != nil {
+		childFile.Close()
+		return fmt.Errorf("error starting unshared child: %v", err)
+	}
+	childFile.Close()
+
+	buf := make([]byte, 1)
+	if _, err := parentFile.Read(buf); err != nil {
+		return fmt.Errorf("error waiting for unshared child to be ready: %v", err)
+	}
+
+	if err := writeIDMappings(c.Process.Pid, c.UidMappings, c.GidMappings); err != nil {
+		return err
+	}
+
+	if _, err := parentFile.Write([]byte("1")); err != nil {
+		return fmt.Errorf("error telling unshared child to continue: %v", err)
+	}
+	return nil
+}
+
+// writeIDMappings writes the requested UID and GID mappings for pid using
+// newuidmap(1) and newgidmap(1), which is required whenever more than one
+// mapping is requested, since only a setuid helper is allowed to do that on
+// behalf of an unprivileged user.
+func writeIDMappings(pid int, uidMappings, gidMappings []idtools.IDMap) error {
+	if len(uidMappings) > 0 {
+		if err := runIDMapHelper("newuidmap", pid, uidMappings); err != nil {
+			return err
+		}
+	}
+	if len(gidMappings) > 0 {
+		if err := runIDMapHelper("newgidmap", pid, gidMappings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runIDMapHelper(helper string, pid int, mappings []idtools.IDMap) error {
+	args := []string{strconv.Itoa(pid)}
+	for _, m := range mappings {
+		args = append(args, strconv.Itoa(m.ContainerID), strconv.Itoa(m.HostID), strconv.Itoa(m.Size))
+	}
+	cmd := exec.Command(helper, args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error running %s: %v: %s", helper, err, string(output))
+	}
+	return nil
+}
+
+// ReexecedEnv marks a process as having already been re-executed by
+// MaybeReexecUsingUserNamespace, so that it doesn't try to re-exec itself
+// again.
+const ReexecedEnv = "_Buildah-has-unshared"
+
+// IsRootless returns true if the process's effective UID is not 0.  It does
+// not check which user namespace that UID belongs to, so it returns false
+// for UID 0 inside a user namespace that we set up.
+func IsRootless() bool {
+	return os.Geteuid() != 0
+}
+
+// MaybeReexecUsingUserNamespace re-execs the current process in a new user
+// and mount namespace with the given UID/GID mappings applied, unless it's
+// already running in one that we set up, or no mappings were requested.  If
+// it re-execs, it does not return: it exits with the child's exit status
+// once the child finishes.
+func MaybeReexecUsingUserNamespace(uidMappings, gidMappings []idtools.IDMap) {
+	if os.Getenv(ReexecedEnv) != "" {
+		return
+	}
+	if len(uidMappings) == 0 && len(gidMappings) == 0 {
+		return
+	}
+	cmd := Command(os.Args)
+	cmd.UidMappings = uidMappings
+	cmd.GidMappings = gidMappings
+	cmd.Env = append(os.Environ(), ReexecedEnv+"=1")
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitError.Sys().(syscall.WaitStatus); ok {
+				os.Exit(status.ExitStatus())
+			}
+		}
+		fmt.Fprintf(os.Stderr, "error re-execing in new user namespace: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// socketPair returns a connected pair of *os.File, suitable for passing one
+// half to a child process via ExtraFiles, which we use to synchronize with
+// the child after it unshares its namespaces but before it continues
+// running.
+func socketPair() (parent, child *os.File, err error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return os.NewFile(uintptr(fds[0]), "parent"), os.NewFile(uintptr(fds[1]), "child"), nil
+}
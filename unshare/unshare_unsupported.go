@@ -0,0 +1,18 @@
+// +build !linux
+
+package unshare
+
+import (
+	"github.com/containers/storage/pkg/idtools"
+)
+
+// IsRootless returns false on platforms where we don't support user
+// namespaces.
+func IsRootless() bool {
+	return false
+}
+
+// MaybeReexecUsingUserNamespace is a no-op on platforms where we don't
+// support user namespaces.
+func MaybeReexecUsingUserNamespace(uidMappings, gidMappings []idtools.IDMap) {
+}